@@ -15,12 +15,19 @@
 package managedresources
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
 	"time"
 
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
 	v1beta1constants "github.com/gardener/gardener/pkg/apis/core/v1beta1/constants"
 	"github.com/gardener/gardener/pkg/chartrenderer"
+	"github.com/gardener/gardener/pkg/utils"
 	"github.com/gardener/gardener/pkg/utils/chart"
 	"github.com/gardener/gardener/pkg/utils/imagevector"
 	kutil "github.com/gardener/gardener/pkg/utils/kubernetes"
@@ -30,11 +37,17 @@ import (
 	resourcesv1alpha1 "github.com/gardener/gardener-resource-manager/pkg/apis/resources/v1alpha1"
 	"github.com/gardener/gardener-resource-manager/pkg/manager"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apidiff "k8s.io/apimachinery/pkg/util/diff"
 	k8sretry "k8s.io/client-go/util/retry"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	sigsyaml "sigs.k8s.io/yaml"
 )
 
 const (
@@ -89,13 +102,32 @@ func NewForSeed(c client.Client, namespace, name string, keepObjects bool) *mana
 	return New(c, namespace, name, v1beta1constants.SeedResourceManagerClass, &keepObjects, nil, nil, nil)
 }
 
-// NewSecret initiates a new Secret object which can be reconciled.
-func NewSecret(client client.Client, namespace, name string, data map[string][]byte, secretNameWithPrefix bool) (string, *manager.Secret) {
+// NewSecret initiates a new Secret object which can be reconciled. By default, data exceeding
+// DefaultCompressionThreshold is gzip compressed; use WithCompression or WithCompressionThreshold to change this.
+func NewSecret(client client.Client, namespace, name string, data map[string][]byte, secretNameWithPrefix bool, opts ...CreateOption) (string, *manager.Secret, error) {
 	secretName := SecretName(name, secretNameWithPrefix)
-	return secretName, manager.
+
+	secret, _, err := newCompressedSecret(client, namespace, secretName, data, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return secretName, secret, nil
+}
+
+// newCompressedSecret builds a reconcilable Secret object for namespace/name, gzip compressing data per opts (see
+// NewSecret), and also returns the compression annotations so callers that build a ManagedResource referencing this
+// secret (see createManagedResourceAndSecret and ChunkedCreate) can put the same annotations on it.
+func newCompressedSecret(client client.Client, namespace, name string, data map[string][]byte, opts []CreateOption) (*manager.Secret, map[string]string, error) {
+	compressed, annotations, err := maybeCompress(data, applyCreateOptions(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return manager.
 		NewSecret(client).
-		WithNamespacedName(namespace, secretName).
-		WithKeyValues(data)
+		WithNamespacedName(namespace, name).
+		WithKeyValues(compressed), annotations, nil
 }
 
 // CreateFromUnstructured creates a managed resource and its secret with the given name, class, and objects in the given namespace.
@@ -112,45 +144,594 @@ func CreateFromUnstructured(ctx context.Context, client client.Client, namespace
 	return Create(ctx, client, namespace, name, secretNameWithPrefix, class, map[string][]byte{name: data}, &keepObjects, injectedLabels, pointer.BoolPtr(false))
 }
 
-// Create creates a managed resource and its secret with the given name, class, key, and data in the given namespace.
-func Create(ctx context.Context, client client.Client, namespace, name string, secretNameWithPrefix bool, class string, data map[string][]byte, keepObjects *bool, injectedLabels map[string]string, forceOverwriteAnnotations *bool) error {
-	var (
-		secretName, secret = NewSecret(client, namespace, name, data, secretNameWithPrefix)
-		managedResource    = New(client, namespace, name, class, keepObjects, nil, injectedLabels, forceOverwriteAnnotations).WithSecretRef(secretName)
-	)
+// installOrderGroup describes the relative ordering in which a resource kind should be applied within a
+// ManagedResource, matching the Helm/kubectl install-order convention (lower values sort first).
+type installOrderGroup int
+
+const (
+	groupCRDs installOrderGroup = iota
+	groupNamespaces
+	groupRBAC
+	groupConfigAndSecrets
+	groupServices
+	groupWorkloads
+	groupOther
+)
 
-	return deployManagedResource(ctx, secret, managedResource)
+// installOrder is the fallback GVK -> installOrderGroup table used by CreateFromUnstructuredOrdered for objects
+// that don't match a more specific rule.
+var installOrder = map[schema.GroupVersionKind]installOrderGroup{
+	{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}:      groupCRDs,
+	{Group: "apiextensions.k8s.io", Version: "v1beta1", Kind: "CustomResourceDefinition"}: groupCRDs,
+	{Version: "v1", Kind: "Namespace"}:                                                    groupNamespaces,
+	{Version: "v1", Kind: "ServiceAccount"}:                                               groupRBAC,
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}:              groupRBAC,
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"}:       groupRBAC,
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"}:                     groupRBAC,
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"}:              groupRBAC,
+	{Version: "v1", Kind: "ConfigMap"}:                                                    groupConfigAndSecrets,
+	{Version: "v1", Kind: "Secret"}:                                                       groupConfigAndSecrets,
+	{Version: "v1", Kind: "Service"}:                                                      groupServices,
+	{Group: "apps", Version: "v1", Kind: "Deployment"}:                                    groupWorkloads,
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"}:                                     groupWorkloads,
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"}:                                   groupWorkloads,
+	{Group: "batch", Version: "v1", Kind: "Job"}:                                          groupWorkloads,
 }
 
-// CreateForSeed deploys a ManagedResource CR for the seed's gardener-resource-manager.
-func CreateForSeed(ctx context.Context, client client.Client, namespace, name string, keepObjects bool, data map[string][]byte) error {
-	var (
-		secretName, secret = NewSecret(client, namespace, name, data, true)
-		managedResource    = NewForSeed(client, namespace, name, keepObjects).WithSecretRef(secretName)
-	)
+// installOrderGroupFor returns the install-order group of the given GVK, falling back to groupOther for anything
+// not covered by the table (most notably the CRs of CRDs bundled in the same manifest).
+func installOrderGroupFor(gvk schema.GroupVersionKind) installOrderGroup {
+	if group, ok := installOrder[gvk]; ok {
+		return group
+	}
+	return groupOther
+}
+
+// key returns the secret data key under which objects of this install-order group are stored.
+func (g installOrderGroup) key(name string) string {
+	switch g {
+	case groupCRDs:
+		return name + "-00-crds.yaml"
+	case groupNamespaces:
+		return name + "-01-namespaces.yaml"
+	case groupRBAC:
+		return name + "-02-rbac.yaml"
+	case groupConfigAndSecrets:
+		return name + "-03-config.yaml"
+	case groupServices:
+		return name + "-04-services.yaml"
+	case groupWorkloads:
+		return name + "-05-workloads.yaml"
+	default:
+		return name + "-06-other.yaml"
+	}
+}
+
+// CreateFromUnstructuredOrdered behaves like CreateFromUnstructured, but first sorts the given objects into
+// install-order phases (CRDs -> Namespaces -> ServiceAccounts/RBAC -> ConfigMaps/Secrets -> Services -> workloads
+// -> everything else) using a stable sort, and stores each phase under its own key in the secret so that
+// gardener-resource-manager applies them in that order and operators can see the phases individually. If
+// waitForCRDs is set, the CustomResourceDefinitions contained in objs must reach status condition
+// Established=True before this function returns.
+//
+// c is the client used to create the ManagedResource and its secret, i.e. it always talks to the seed. targetClient
+// is the client used to poll for CRDs becoming Established; it must talk to whichever cluster
+// gardener-resource-manager actually applies the given class of ManagedResource into. For a seed-class
+// ManagedResource that is the seed itself, so targetClient may be nil to default to c. For a shoot-class
+// ManagedResource (the Calico use case this function was written for) targetClient must be a client for the
+// shoot, since that is where the bundled CRDs are applied - polling them via the seed client would 404 forever.
+func CreateFromUnstructuredOrdered(ctx context.Context, c, targetClient client.Client, namespace, name string, secretNameWithPrefix bool, class string, objs []*unstructured.Unstructured, keepObjects bool, injectedLabels map[string]string, waitForCRDs bool) error {
+	sorted := make([]*unstructured.Unstructured, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return installOrderGroupFor(sorted[i].GroupVersionKind()) < installOrderGroupFor(sorted[j].GroupVersionKind())
+	})
+
+	data := map[string][]byte{}
+	for _, obj := range sorted {
+		bytes, err := obj.MarshalJSON()
+		if err != nil {
+			return errors.Wrapf(err, "marshal failed for '%s/%s' for secret '%s/%s'", obj.GetNamespace(), obj.GetName(), namespace, name)
+		}
+
+		key := installOrderGroupFor(obj.GroupVersionKind()).key(name)
+		data[key] = append(append(data[key], []byte("\n---\n")...), bytes...)
+	}
+
+	if err := Create(ctx, c, namespace, name, secretNameWithPrefix, class, data, &keepObjects, injectedLabels, pointer.BoolPtr(false)); err != nil {
+		return err
+	}
+
+	if waitForCRDs {
+		if targetClient == nil {
+			targetClient = c
+		}
+		return waitUntilCRDsEstablished(ctx, targetClient, sorted)
+	}
+
+	return nil
+}
+
+var crdGroupVersionKinds = map[schema.GroupVersionKind]bool{
+	{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}:      true,
+	{Group: "apiextensions.k8s.io", Version: "v1beta1", Kind: "CustomResourceDefinition"}: true,
+}
+
+// waitUntilCRDsEstablished blocks until every CustomResourceDefinition among objs reports status condition
+// Established=True.
+func waitUntilCRDsEstablished(ctx context.Context, c client.Client, objs []*unstructured.Unstructured) error {
+	var crdNames []string
+	for _, obj := range objs {
+		if crdGroupVersionKinds[obj.GroupVersionKind()] {
+			crdNames = append(crdNames, obj.GetName())
+		}
+	}
+	if len(crdNames) == 0 {
+		return nil
+	}
+
+	return retry.Until(ctx, IntervalWait, func(ctx context.Context) (done bool, err error) {
+		for _, crdName := range crdNames {
+			crd := &unstructured.Unstructured{}
+			crd.SetGroupVersionKind(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+			if err := c.Get(ctx, kutil.Key("", crdName), crd); err != nil {
+				return retry.SevereError(err)
+			}
+
+			if !isCRDEstablished(crd) {
+				return retry.MinorError(fmt.Errorf("custom resource definition %q is not yet established", crdName))
+			}
+		}
+		return retry.Ok()
+	})
+}
+
+func isCRDEstablished(crd *unstructured.Unstructured) bool {
+	conditions, found, err := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	if err != nil || !found {
+		return false
+	}
+
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	// CompressionAnnotation is the annotation stamped on a ManagedResource whose secret data has been gzip
+	// compressed by Create and friends.
+	CompressionAnnotation = "resources.gardener.cloud/compression-method"
+	// GzipCompression is the CompressionAnnotation value used for gzip-compressed data.
+	GzipCompression = "gzip"
+	// DefaultCompressionThreshold is the uncompressed payload size (sum of all data values, in bytes) above
+	// which Create and friends gzip the secret data by default.
+	DefaultCompressionThreshold = 512 * 1024
+)
+
+// CreateOptions bundles optional, secondary knobs for Create, CreateForSeed, CreateForShoot, RenderChartAndCreate,
+// ChunkedCreate, and NewSecret.
+type CreateOptions struct {
+	// Compress forces gzip compression of the secret's data, regardless of its size.
+	Compress bool
+	// CompressionThreshold enables gzip compression once the uncompressed payload exceeds this many bytes.
+	// Ignored if Compress is set. A zero or negative value disables automatic compression.
+	CompressionThreshold int
+}
+
+// CreateOption mutates CreateOptions. With no options given, the defaults (as produced by applyCreateOptions)
+// compress payloads larger than DefaultCompressionThreshold.
+type CreateOption func(*CreateOptions)
+
+// WithCompression unconditionally gzip-compresses the secret's data.
+func WithCompression() CreateOption {
+	return func(o *CreateOptions) { o.Compress = true }
+}
+
+// WithCompressionThreshold overrides the payload size (in bytes) above which the secret's data is gzip
+// compressed. Pass 0 to disable automatic compression entirely.
+func WithCompressionThreshold(threshold int) CreateOption {
+	return func(o *CreateOptions) { o.CompressionThreshold = threshold }
+}
+
+func applyCreateOptions(opts []CreateOption) *CreateOptions {
+	o := &CreateOptions{CompressionThreshold: DefaultCompressionThreshold}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// maybeCompress gzip-compresses every value in data and suffixes its key with ".gz" if compression was requested
+// or the combined payload size exceeds the configured threshold. It returns the (possibly unchanged) data map
+// together with the annotations that should be stamped on the owning ManagedResource.
+func maybeCompress(data map[string][]byte, opts *CreateOptions) (map[string][]byte, map[string]string, error) {
+	if !opts.Compress {
+		if opts.CompressionThreshold <= 0 {
+			return data, nil, nil
+		}
+
+		size := 0
+		for _, v := range data {
+			size += len(v)
+		}
+		if size <= opts.CompressionThreshold {
+			return data, nil, nil
+		}
+	}
+
+	compressed := make(map[string][]byte, len(data))
+	for key, value := range data {
+		var buf bytes.Buffer
+
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(value); err != nil {
+			return nil, nil, errors.Wrapf(err, "could not gzip value for key %q", key)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, nil, errors.Wrapf(err, "could not gzip value for key %q", key)
+		}
+
+		compressed[key+".gz"] = buf.Bytes()
+	}
+
+	return compressed, map[string]string{CompressionAnnotation: GzipCompression}, nil
+}
+
+// DecompressData reverses the gzip compression applied by Create and friends, returning a map keyed by the
+// original (non-suffixed) keys. Keys that were not compressed are passed through unchanged. It is primarily
+// intended for tests that need to assert on the rendered manifests of a compressed ManagedResource secret.
+func DecompressData(data map[string][]byte) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(data))
+
+	for key, value := range data {
+		if !strings.HasSuffix(key, ".gz") {
+			result[key] = value
+			continue
+		}
+
+		gz, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not create gzip reader for key %q", key)
+		}
+
+		raw, err := ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not decompress value for key %q", key)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, errors.Wrapf(err, "could not close gzip reader for key %q", key)
+		}
+
+		result[strings.TrimSuffix(key, ".gz")] = raw
+	}
+
+	return result, nil
+}
+
+// createManagedResourceAndSecret contains the logic shared by Create, CreateForSeed, and CreateForShoot: resolving
+// the secret the managed resource currently references (so a previous terminating-secret replacement isn't
+// forgotten, see resolveCurrentSecretName), freshening it if it is itself stuck terminating, optionally
+// compressing the data, and deploying both objects. newManagedResource receives the (possibly freshened) secret
+// name to reference and must return the managed resource to reconcile.
+func createManagedResourceAndSecret(ctx context.Context, c client.Client, namespace, name string, fallbackSecretName string, data map[string][]byte, opts []CreateOption, newManagedResource func(secretName string) *manager.ManagedResource) error {
+	currentSecretName, err := resolveCurrentSecretName(ctx, c, namespace, name, fallbackSecretName)
+	if err != nil {
+		return err
+	}
 
-	return deployManagedResource(ctx, secret, managedResource)
+	freshSecretName, err := freshenTerminatingSecret(ctx, c, namespace, currentSecretName)
+	if err != nil {
+		return err
+	}
+
+	secret, annotations, err := newCompressedSecret(c, namespace, freshSecretName, data, opts)
+	if err != nil {
+		return err
+	}
+
+	managedResource := newManagedResource(freshSecretName)
+	if len(annotations) > 0 {
+		managedResource = managedResource.WithAnnotations(annotations)
+	}
+
+	return deployManagedResource(ctx, c, namespace, currentSecretName, freshSecretName, secret, managedResource)
+}
+
+// Create creates a managed resource and its secret with the given name, class, key, and data in the given
+// namespace. By default, data exceeding DefaultCompressionThreshold is gzip compressed; use WithCompression or
+// WithCompressionThreshold to change this.
+func Create(ctx context.Context, c client.Client, namespace, name string, secretNameWithPrefix bool, class string, data map[string][]byte, keepObjects *bool, injectedLabels map[string]string, forceOverwriteAnnotations *bool, opts ...CreateOption) error {
+	return createManagedResourceAndSecret(ctx, c, namespace, name, SecretName(name, secretNameWithPrefix), data, opts, func(secretName string) *manager.ManagedResource {
+		return New(c, namespace, name, class, keepObjects, nil, injectedLabels, forceOverwriteAnnotations).WithSecretRef(secretName)
+	})
+}
+
+// CreateForSeed deploys a ManagedResource CR for the seed's gardener-resource-manager.
+func CreateForSeed(ctx context.Context, c client.Client, namespace, name string, keepObjects bool, data map[string][]byte, opts ...CreateOption) error {
+	return createManagedResourceAndSecret(ctx, c, namespace, name, SecretName(name, true), data, opts, func(secretName string) *manager.ManagedResource {
+		return NewForSeed(c, namespace, name, keepObjects).WithSecretRef(secretName)
+	})
 }
 
 // CreateForShoot deploys a ManagedResource CR for the shoot's gardener-resource-manager.
-func CreateForShoot(ctx context.Context, client client.Client, namespace, name string, keepObjects bool, data map[string][]byte) error {
+func CreateForShoot(ctx context.Context, c client.Client, namespace, name string, keepObjects bool, data map[string][]byte, opts ...CreateOption) error {
+	return createManagedResourceAndSecret(ctx, c, namespace, name, SecretName(name, true), data, opts, func(secretName string) *manager.ManagedResource {
+		return NewForShoot(c, namespace, name, keepObjects).WithSecretRef(secretName)
+	})
+}
+
+// maxShardSize is a conservative cap (in bytes, before base64 encoding) on the amount of data ChunkedCreate packs
+// into a single secret, staying safely under the ~1MiB etcd/API object size limit even after base64 overhead.
+const maxShardSize = 750 * 1024
+
+// ChunkedCreate behaves like Create, but additionally shards the (optionally compressed) data across as many
+// secrets as necessary to stay under maxShardSize, and points the ManagedResource's Spec.SecretRefs at all of
+// them. Use this instead of Create whenever the rendered manifests may approach the ~1MiB Secret size limit even
+// after compression (e.g. large third-party charts).
+func ChunkedCreate(ctx context.Context, c client.Client, namespace, name string, secretNameWithPrefix bool, class string, data map[string][]byte, keepObjects *bool, injectedLabels map[string]string, forceOverwriteAnnotations *bool, opts ...CreateOption) error {
+	compressed, annotations, err := maybeCompress(data, applyCreateOptions(opts))
+	if err != nil {
+		return err
+	}
+
+	shards := shardData(compressed, maxShardSize)
+
+	baseName := SecretName(name, secretNameWithPrefix)
+	fallbackNames := make([]string, len(shards))
+	for i := range shards {
+		fallbackNames[i] = baseName
+		if i > 0 {
+			fallbackNames[i] = fmt.Sprintf("%s-%d", baseName, i)
+		}
+	}
+
+	currentNames, staleNames, err := resolveCurrentSecretNames(ctx, c, namespace, name, fallbackNames)
+	if err != nil {
+		return err
+	}
+
+	secretNames := make([]string, 0, len(shards))
+	// renamed maps a freshly minted shard name back to the terminating shard it replaces, so that the old shard's
+	// finalizers can be stripped once the managed resource no longer references it.
+	renamed := map[string]string{}
+
+	for i, shard := range shards {
+		freshSecretName, err := freshenTerminatingSecret(ctx, c, namespace, currentNames[i])
+		if err != nil {
+			return err
+		}
+
+		secret := manager.NewSecret(c).WithNamespacedName(namespace, freshSecretName).WithKeyValues(shard)
+		if err := secret.Reconcile(ctx); err != nil {
+			return errors.Wrapf(err, "could not create or update secret shard '%s/%s' of managed resources", namespace, freshSecretName)
+		}
+
+		if freshSecretName != currentNames[i] {
+			if err := copyGardenerOwnedMetadata(ctx, c, namespace, currentNames[i], freshSecretName); err != nil {
+				return errors.Wrapf(err, "could not copy metadata from terminating secret '%s/%s'", namespace, currentNames[i])
+			}
+			renamed[freshSecretName] = currentNames[i]
+		}
+
+		secretNames = append(secretNames, freshSecretName)
+	}
+
+	managedResource := New(c, namespace, name, class, keepObjects, nil, injectedLabels, forceOverwriteAnnotations).WithSecretRef(secretNames...)
+	if len(annotations) > 0 {
+		managedResource = managedResource.WithAnnotations(annotations)
+	}
+
+	if err := managedResource.Reconcile(ctx); err != nil {
+		return errors.Wrap(err, "could not create or update managed resource")
+	}
+
+	for _, oldShardName := range renamed {
+		if err := releaseTerminatingSecret(ctx, c, namespace, oldShardName); err != nil {
+			return errors.Wrapf(err, "could not release terminating secret shard '%s/%s'", namespace, oldShardName)
+		}
+	}
+
+	// The managed resource no longer references these - a previous, larger reconcile needed more shards than this
+	// one does - so they must be deleted outright rather than left behind as orphans.
+	for _, staleShardName := range staleNames {
+		if err := c.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: staleShardName}}); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "could not delete stale secret shard '%s/%s'", namespace, staleShardName)
+		}
+	}
+
+	return nil
+}
+
+// shardData packs the given key/value pairs into one or more maps such that the total size of each map stays at
+// or below maxBytes on a best-effort basis; a single value larger than maxBytes gets its own shard.
+func shardData(data map[string][]byte, maxBytes int) []map[string][]byte {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	var (
-		secretName, secret = NewSecret(client, namespace, name, data, true)
-		managedResource    = NewForShoot(client, namespace, name, keepObjects).WithSecretRef(secretName)
+		shards       []map[string][]byte
+		current      = map[string][]byte{}
+		currentBytes int
 	)
 
-	return deployManagedResource(ctx, secret, managedResource)
+	for _, key := range keys {
+		value := data[key]
+		if currentBytes > 0 && currentBytes+len(value) > maxBytes {
+			shards = append(shards, current)
+			current = map[string][]byte{}
+			currentBytes = 0
+		}
+		current[key] = value
+		currentBytes += len(value)
+	}
+	if len(current) > 0 || len(shards) == 0 {
+		shards = append(shards, current)
+	}
+
+	return shards
 }
 
-func deployManagedResource(ctx context.Context, secret *manager.Secret, managedResource *manager.ManagedResource) error {
+// resolveCurrentSecretName returns the name of the secret the managed resource <name> currently references
+// (i.e. `Spec.SecretRefs[0].Name`), falling back to <fallbackSecretName> if the managed resource doesn't exist yet
+// or doesn't reference a secret. Callers must use this - and not the canonical SecretName(name, prefix) - to
+// decide which secret is "the current one": once freshenTerminatingSecret has renamed a terminating secret and
+// repointed the managed resource at it, the canonical name may no longer exist (it was released and garbage
+// collected), which must not be mistaken for "nothing to freshen" on the next reconcile.
+func resolveCurrentSecretName(ctx context.Context, c client.Client, namespace, name, fallbackSecretName string) (string, error) {
+	mr := &resourcesv1alpha1.ManagedResource{}
+	if err := c.Get(ctx, kutil.Key(namespace, name), mr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fallbackSecretName, nil
+		}
+		return "", errors.Wrapf(err, "could not get managed resource '%s/%s'", namespace, name)
+	}
+
+	if len(mr.Spec.SecretRefs) > 0 && mr.Spec.SecretRefs[0].Name != "" {
+		return mr.Spec.SecretRefs[0].Name, nil
+	}
+
+	return fallbackSecretName, nil
+}
+
+// resolveCurrentSecretNames is the ChunkedCreate analogue of resolveCurrentSecretName: for each fallback shard
+// name (indexed the same way ChunkedCreate numbers its shards), it returns the name of the secret the managed
+// resource's corresponding Spec.SecretRefs entry currently points at, if any. It also returns staleNames, the
+// names of any secrets the managed resource currently references beyond fallbackSecretNames - i.e. shards a
+// previous, larger reconcile created that the current (smaller) data set no longer needs - so that callers can
+// clean them up instead of silently dropping them from Spec.SecretRefs and orphaning them.
+func resolveCurrentSecretNames(ctx context.Context, c client.Client, namespace, name string, fallbackSecretNames []string) (names, staleNames []string, err error) {
+	mr := &resourcesv1alpha1.ManagedResource{}
+	if err := c.Get(ctx, kutil.Key(namespace, name), mr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fallbackSecretNames, nil, nil
+		}
+		return nil, nil, errors.Wrapf(err, "could not get managed resource '%s/%s'", namespace, name)
+	}
+
+	names = make([]string, len(fallbackSecretNames))
+	copy(names, fallbackSecretNames)
+	for i := range names {
+		if i < len(mr.Spec.SecretRefs) && mr.Spec.SecretRefs[i].Name != "" {
+			names[i] = mr.Spec.SecretRefs[i].Name
+		}
+	}
+
+	for i := len(fallbackSecretNames); i < len(mr.Spec.SecretRefs); i++ {
+		if ref := mr.Spec.SecretRefs[i]; ref.Name != "" {
+			staleNames = append(staleNames, ref.Name)
+		}
+	}
+
+	return names, staleNames, nil
+}
+
+// terminatingSecretNameSuffixLength is the length of the random suffix appended to the name of a replacement
+// secret when the original one is stuck terminating.
+const terminatingSecretNameSuffixLength = 5
+
+// freshenTerminatingSecret checks whether the secret with the given name already exists in the namespace but is
+// terminating (i.e. has a non-zero DeletionTimestamp, typically because a finalizer is blocking its actual
+// removal). Reconciling against such a secret would race the finalizer and can block indefinitely, so instead a
+// fresh, uniquely suffixed name is returned for the caller to create a brand new secret under. If no terminating
+// secret is found, <secretName> is returned unchanged.
+func freshenTerminatingSecret(ctx context.Context, c client.Client, namespace, secretName string) (string, error) {
+	existing := &corev1.Secret{}
+	if err := c.Get(ctx, kutil.Key(namespace, secretName), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return secretName, nil
+		}
+		return "", errors.Wrapf(err, "could not get secret '%s/%s'", namespace, secretName)
+	}
+
+	if existing.DeletionTimestamp == nil {
+		return secretName, nil
+	}
+
+	suffix, err := utils.GenerateRandomString(terminatingSecretNameSuffixLength)
+	if err != nil {
+		return "", errors.Wrap(err, "could not generate name for replacement secret")
+	}
+
+	return secretName + "-" + strings.ToLower(suffix), nil
+}
+
+// copyGardenerOwnedMetadata copies the gardener-owned labels and annotations (i.e. the "origin" label and the
+// shoot no-cleanup label) from the old, terminating secret onto the freshly created one.
+func copyGardenerOwnedMetadata(ctx context.Context, c client.Client, namespace, oldSecretName, newSecretName string) error {
+	old := &corev1.Secret{}
+	if err := c.Get(ctx, kutil.Key(namespace, oldSecretName), old); err != nil {
+		return apierrors.IgnoreNotFound(err)
+	}
+
+	fresh := &corev1.Secret{}
+	if err := c.Get(ctx, kutil.Key(namespace, newSecretName), fresh); err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(fresh.DeepCopy())
+	for k, v := range old.Labels {
+		if strings.HasPrefix(k, "gardener.cloud/") || k == LabelKeyOrigin || k == v1beta1constants.ShootNoCleanup {
+			metav1.SetMetaDataLabel(&fresh.ObjectMeta, k, v)
+		}
+	}
+	for k, v := range old.Annotations {
+		if strings.HasPrefix(k, "gardener.cloud/") || k == LabelKeyOrigin || k == v1beta1constants.ShootNoCleanup {
+			metav1.SetMetaDataAnnotation(&fresh.ObjectMeta, k, v)
+		}
+	}
+
+	return c.Patch(ctx, fresh, patch)
+}
+
+// releaseTerminatingSecret strips the finalizers from the old, terminating secret so that it can finally be
+// garbage-collected now that the managed resource no longer references it.
+func releaseTerminatingSecret(ctx context.Context, c client.Client, namespace, secretName string) error {
+	old := &corev1.Secret{}
+	if err := c.Get(ctx, kutil.Key(namespace, secretName), old); err != nil {
+		return apierrors.IgnoreNotFound(err)
+	}
+
+	if old.DeletionTimestamp == nil || len(old.Finalizers) == 0 {
+		return nil
+	}
+
+	patch := client.MergeFrom(old.DeepCopy())
+	old.Finalizers = nil
+	return apierrors.IgnoreNotFound(c.Patch(ctx, old, patch))
+}
+
+func deployManagedResource(ctx context.Context, c client.Client, namespace, oldSecretName, newSecretName string, secret *manager.Secret, managedResource *manager.ManagedResource) error {
 	if err := secret.Reconcile(ctx); err != nil {
 		return errors.Wrapf(err, "could not create or update secret of managed resources")
 	}
 
+	if newSecretName != oldSecretName {
+		if err := copyGardenerOwnedMetadata(ctx, c, namespace, oldSecretName, newSecretName); err != nil {
+			return errors.Wrapf(err, "could not copy metadata from terminating secret '%s/%s'", namespace, oldSecretName)
+		}
+	}
+
 	if err := managedResource.Reconcile(ctx); err != nil {
 		return errors.Wrapf(err, "could not create or update managed resource")
 	}
 
+	if newSecretName != oldSecretName {
+		if err := releaseTerminatingSecret(ctx, c, namespace, oldSecretName); err != nil {
+			return errors.Wrapf(err, "could not release terminating secret '%s/%s'", namespace, oldSecretName)
+		}
+	}
+
 	return nil
 }
 
@@ -211,6 +792,162 @@ func WaitUntilHealthy(ctx context.Context, client client.Client, namespace, name
 	})
 }
 
+// WaitOptions bundles the tunables for WaitUntilApplied, WaitUntilProgressingFinished, and
+// WaitUntilHealthyAndNotProgressing.
+type WaitOptions struct {
+	// Interval is the polling interval. Defaults to IntervalWait if zero.
+	Interval time.Duration
+	// Predicate, if set, is consulted on every successful poll in addition to the built-in condition checks; it
+	// can be used to add caller-specific readiness checks (e.g. a minimum observed generation).
+	Predicate func(*resourcesv1alpha1.ManagedResource) (done bool, err error)
+}
+
+// WaitOption mutates WaitOptions.
+type WaitOption func(*WaitOptions)
+
+// WithWaitInterval overrides the polling interval used by the WaitUntil* functions.
+func WithWaitInterval(interval time.Duration) WaitOption {
+	return func(o *WaitOptions) { o.Interval = interval }
+}
+
+// WithWaitPredicate adds a caller-specific readiness check that is consulted on every successful poll.
+func WithWaitPredicate(predicate func(*resourcesv1alpha1.ManagedResource) (bool, error)) WaitOption {
+	return func(o *WaitOptions) { o.Predicate = predicate }
+}
+
+func applyWaitOptions(opts []WaitOption) *WaitOptions {
+	o := &WaitOptions{Interval: IntervalWait}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ConditionError is returned by WaitUntilApplied, WaitUntilProgressingFinished, and
+// WaitUntilHealthyAndNotProgressing when the awaited condition doesn't reach its desired state before the context
+// is done. It embeds the condition's Reason and Message, plus the last observed Status.Resources, so that
+// operators don't have to `kubectl describe` the ManagedResource to diagnose a stuck rollout.
+type ConditionError struct {
+	Namespace     string
+	Name          string
+	ConditionType gardencorev1beta1.ConditionType
+	Reason        string
+	Message       string
+	Resources     []resourcesv1alpha1.ObjectReference
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf(
+		"managed resource %s/%s: condition %s is not in the desired state (reason=%q, message=%q, resources=%v)",
+		e.Namespace, e.Name, e.ConditionType, e.Reason, e.Message, e.Resources,
+	)
+}
+
+func getCondition(obj *resourcesv1alpha1.ManagedResource, conditionType gardencorev1beta1.ConditionType) *gardencorev1beta1.Condition {
+	for i := range obj.Status.Conditions {
+		if obj.Status.Conditions[i].Type == conditionType {
+			return &obj.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// waitUntilCondition polls the given managed resource until its condition of type conditionType is in status
+// wantStatus.
+func waitUntilCondition(ctx context.Context, c client.Client, namespace, name string, conditionType gardencorev1beta1.ConditionType, wantStatus gardencorev1beta1.ConditionStatus, opts *WaitOptions) error {
+	obj := &resourcesv1alpha1.ManagedResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+
+	return retry.Until(ctx, opts.Interval, func(ctx context.Context) (done bool, err error) {
+		if err := c.Get(ctx, kutil.Key(namespace, name), obj); err != nil {
+			return retry.SevereError(err)
+		}
+
+		condition := getCondition(obj, conditionType)
+		if condition == nil {
+			return retry.MinorError(fmt.Errorf("managed resource %s/%s: condition %s has not been reported yet", namespace, name, conditionType))
+		}
+
+		if condition.Status != wantStatus {
+			return retry.MinorError(&ConditionError{
+				Namespace:     namespace,
+				Name:          name,
+				ConditionType: conditionType,
+				Reason:        condition.Reason,
+				Message:       condition.Message,
+				Resources:     obj.Status.Resources,
+			})
+		}
+
+		if opts.Predicate != nil {
+			return opts.Predicate(obj)
+		}
+
+		return retry.Ok()
+	})
+}
+
+// WaitUntilApplied waits until the given managed resource's ResourcesApplied condition is True, distinguishing
+// "managed resource not yet observed by gardener-resource-manager" from "observed but application failed" via the
+// returned *ConditionError.
+func WaitUntilApplied(ctx context.Context, c client.Client, namespace, name string, opts ...WaitOption) error {
+	return waitUntilCondition(ctx, c, namespace, name, resourcesv1alpha1.ResourcesApplied, gardencorev1beta1.ConditionTrue, applyWaitOptions(opts))
+}
+
+// WaitUntilProgressingFinished waits until the given managed resource's ResourcesProgressing condition is False,
+// i.e. gardener-resource-manager observed that all applied resources (Deployments, DaemonSets, ...) have finished
+// rolling out.
+func WaitUntilProgressingFinished(ctx context.Context, c client.Client, namespace, name string, opts ...WaitOption) error {
+	return waitUntilCondition(ctx, c, namespace, name, resourcesv1alpha1.ResourcesProgressing, gardencorev1beta1.ConditionFalse, applyWaitOptions(opts))
+}
+
+// WaitUntilHealthyAndNotProgressing waits until the given managed resource is healthy and its ResourcesProgressing
+// condition is False. Unlike WaitUntilHealthy, the returned error distinguishes "managed resource not yet
+// observed" from "managed resource observed but one DaemonSet pod is crash-looping" by embedding the offending
+// condition's Reason, Message, and Status.Resources, so callers don't have to `kubectl describe` to diagnose a
+// stuck rollout.
+func WaitUntilHealthyAndNotProgressing(ctx context.Context, c client.Client, namespace, name string, opts ...WaitOption) error {
+	options := applyWaitOptions(opts)
+
+	obj := &resourcesv1alpha1.ManagedResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+
+	return retry.Until(ctx, options.Interval, func(ctx context.Context) (done bool, err error) {
+		if err := c.Get(ctx, kutil.Key(namespace, name), obj); err != nil {
+			return retry.SevereError(err)
+		}
+
+		if err := health.CheckManagedResource(obj); err != nil {
+			return retry.MinorError(fmt.Errorf("managed resource %s/%s is not healthy: %v (status: %+v)", namespace, name, err, obj.Status))
+		}
+
+		if condition := getCondition(obj, resourcesv1alpha1.ResourcesProgressing); condition != nil && condition.Status == gardencorev1beta1.ConditionTrue {
+			return retry.MinorError(&ConditionError{
+				Namespace:     namespace,
+				Name:          name,
+				ConditionType: resourcesv1alpha1.ResourcesProgressing,
+				Reason:        condition.Reason,
+				Message:       condition.Message,
+				Resources:     obj.Status.Resources,
+			})
+		}
+
+		if options.Predicate != nil {
+			return options.Predicate(obj)
+		}
+
+		return retry.Ok()
+	})
+}
+
 // WaitUntilDeleted waits until the given managed resource is deleted.
 func WaitUntilDeleted(ctx context.Context, client client.Client, namespace, name string) error {
 	mr := &resourcesv1alpha1.ManagedResource{
@@ -243,7 +980,7 @@ func SetKeepObjects(ctx context.Context, c client.Client, namespace, name string
 
 // RenderChartAndCreate renders a chart and creates a ManagedResource for the gardener-resource-manager
 // out of the results.
-func RenderChartAndCreate(ctx context.Context, namespace string, name string, secretNameWithPrefix bool, client client.Client, chartRenderer chartrenderer.Interface, chart chart.Interface, values map[string]interface{}, imageVector imagevector.ImageVector, chartNamespace string, version string, withNoCleanupLabel bool, forceOverwriteAnnotations bool) error {
+func RenderChartAndCreate(ctx context.Context, namespace string, name string, secretNameWithPrefix bool, client client.Client, chartRenderer chartrenderer.Interface, chart chart.Interface, values map[string]interface{}, imageVector imagevector.ImageVector, chartNamespace string, version string, withNoCleanupLabel bool, forceOverwriteAnnotations bool, opts ...CreateOption) error {
 	chartName, data, err := chart.Render(chartRenderer, chartNamespace, imageVector, version, version, values)
 	if err != nil {
 		return errors.Wrapf(err, "could not render chart")
@@ -255,5 +992,175 @@ func RenderChartAndCreate(ctx context.Context, namespace string, name string, se
 		injectedLabels = map[string]string{v1beta1constants.ShootNoCleanup: "true"}
 	}
 
-	return Create(ctx, client, namespace, name, secretNameWithPrefix, "", map[string][]byte{chartName: data}, pointer.BoolPtr(false), injectedLabels, &forceOverwriteAnnotations)
+	return Create(ctx, client, namespace, name, secretNameWithPrefix, "", map[string][]byte{chartName: data}, pointer.BoolPtr(false), injectedLabels, &forceOverwriteAnnotations, opts...)
+}
+
+// resourceKey uniquely identifies an object within a manifest, independent of the key it happens to be stored
+// under in the secret.
+type resourceKey struct {
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+}
+
+func keyForObject(obj *unstructured.Unstructured) resourceKey {
+	return resourceKey{GroupVersionKind: obj.GroupVersionKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+// ResourceChange describes a single object that is present in both the old and the new manifests but differs.
+type ResourceChange struct {
+	Old  *unstructured.Unstructured
+	New  *unstructured.Unstructured
+	Diff string
+}
+
+// ResourceDiff is the result of comparing the manifests currently stored in a ManagedResource's secret(s) against
+// a candidate set of manifests, as computed by Diff and DryRunCreate.
+type ResourceDiff struct {
+	Added   []*unstructured.Unstructured
+	Removed []*unstructured.Unstructured
+	Changed []ResourceChange
+}
+
+// Empty returns true if applying the candidate manifests would not change anything.
+func (d *ResourceDiff) Empty() bool {
+	return d != nil && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// decodeManifests reassembles the manifests stored in a ManagedResource secret's data map, reversing any gzip
+// compression applied by Create and friends (see DecompressData) and splitting each value's "---"-separated YAML
+// documents into individual objects.
+func decodeManifests(data map[string][]byte) ([]*unstructured.Unstructured, error) {
+	decompressed, err := DecompressData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for key, value := range decompressed {
+		for _, doc := range bytes.Split(value, []byte("\n---\n")) {
+			doc = bytes.TrimSpace(doc)
+			if len(doc) == 0 {
+				continue
+			}
+
+			obj := &unstructured.Unstructured{}
+			if err := sigsyaml.Unmarshal(doc, &obj.Object); err != nil {
+				return nil, errors.Wrapf(err, "could not decode manifest in key %q", key)
+			}
+			if len(obj.Object) == 0 {
+				continue
+			}
+
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs, nil
+}
+
+func diffManifests(oldObjs, newObjs []*unstructured.Unstructured) *ResourceDiff {
+	oldByKey := make(map[resourceKey]*unstructured.Unstructured, len(oldObjs))
+	for _, obj := range oldObjs {
+		oldByKey[keyForObject(obj)] = obj
+	}
+
+	result := &ResourceDiff{}
+	seen := make(map[resourceKey]bool, len(newObjs))
+
+	for _, newObj := range newObjs {
+		key := keyForObject(newObj)
+		seen[key] = true
+
+		oldObj, ok := oldByKey[key]
+		if !ok {
+			result.Added = append(result.Added, newObj)
+			continue
+		}
+
+		if !apiequality.Semantic.DeepEqual(oldObj.Object, newObj.Object) {
+			result.Changed = append(result.Changed, ResourceChange{
+				Old:  oldObj,
+				New:  newObj,
+				Diff: apidiff.ObjectDiff(oldObj.Object, newObj.Object),
+			})
+		}
+	}
+
+	for key, oldObj := range oldByKey {
+		if !seen[key] {
+			result.Removed = append(result.Removed, oldObj)
+		}
+	}
+
+	return result
+}
+
+// Diff loads the secret(s) currently backing the ManagedResource named name (if any), decodes their manifests, and
+// compares them against data, the manifests a caller is about to apply. It returns a ResourceDiff describing which
+// objects would be added, removed, or changed, with a diff.ObjectDiff report per changed object, without
+// touching the cluster. This lets an operator preview what a chart-values change will do before it rolls out.
+//
+// The current secret names are read from the ManagedResource's own Spec.SecretRefs rather than derived from the
+// canonical SecretName(name, prefix): once a terminating-secret replacement (see freshenTerminatingSecret) has
+// fired, or for anything created via ChunkedCreate, the canonical name no longer identifies the (only) secret in
+// use, and guessing it would silently compare against the wrong - or a partial - set of manifests.
+func Diff(ctx context.Context, c client.Client, namespace, name string, secretNameWithPrefix bool, data map[string][]byte) (*ResourceDiff, error) {
+	var secretNames []string
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	if err := c.Get(ctx, kutil.Key(namespace, name), mr); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "could not get managed resource '%s/%s'", namespace, name)
+		}
+	} else {
+		for _, ref := range mr.Spec.SecretRefs {
+			secretNames = append(secretNames, ref.Name)
+		}
+	}
+
+	var oldObjs []*unstructured.Unstructured
+
+	for _, secretName := range secretNames {
+		existing := &corev1.Secret{}
+		if err := c.Get(ctx, kutil.Key(namespace, secretName), existing); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "could not get secret '%s/%s'", namespace, secretName)
+		}
+
+		objs, err := decodeManifests(existing.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not decode current manifests of secret '%s/%s'", namespace, secretName)
+		}
+		oldObjs = append(oldObjs, objs...)
+	}
+
+	newObjs, err := decodeManifests(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decode candidate manifests")
+	}
+
+	return diffManifests(oldObjs, newObjs), nil
+}
+
+// DryRunCreate computes the same ResourceDiff as Diff, and additionally exercises Create against a dry-run client
+// (so that defaulting and admission are taken into account) without persisting anything to the cluster.
+//
+// Wiring: this is a library entry point only. Calling it from the Calico extension's reconcile path behind a
+// feature gate (e.g. to log a preview diff before Create) is left to that actuator; no actuator or reconciler
+// exists anywhere in this tree yet to wire it into, and no feature gate plumbing exists to gate it on.
+func DryRunCreate(ctx context.Context, c client.Client, namespace, name string, secretNameWithPrefix bool, class string, data map[string][]byte, keepObjects *bool, injectedLabels map[string]string, forceOverwriteAnnotations *bool, opts ...CreateOption) (*ResourceDiff, error) {
+	diff, err := Diff(ctx, c, namespace, name, secretNameWithPrefix, data)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRunClient := client.NewDryRunClient(c)
+	if err := Create(ctx, dryRunClient, namespace, name, secretNameWithPrefix, class, data, keepObjects, injectedLabels, forceOverwriteAnnotations, opts...); err != nil {
+		return nil, errors.Wrap(err, "dry-run create failed")
+	}
+
+	return diff, nil
 }
@@ -0,0 +1,345 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package managedresources_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	resourcesv1alpha1 "github.com/gardener/gardener-resource-manager/pkg/apis/resources/v1alpha1"
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
+	"github.com/gardener/gardener/pkg/utils/managedresources"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestScheme(t testing.TB) *runtime.Scheme {
+	t.Helper()
+
+	s := runtime.NewScheme()
+	if err := scheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := resourcesv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// calicoLikeManifest builds a repetitive YAML stream of Calico-style ConfigMaps (about 270 bytes per object), for
+// use in the compression benchmark and the Diff test below.
+func calicoLikeManifest(objectCount int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < objectCount; i++ {
+		fmt.Fprintf(&buf, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: calico-config-%d\n  namespace: kube-system\ndata:\n  cni_network_config: |-\n    {\"name\": \"k8s-pod-network\", \"cniVersion\": \"0.3.1\", \"plugins\": [{\"type\": \"calico\", \"log_level\": \"info\", \"datastore_type\": \"kubernetes\"}]}\n", i)
+	}
+	return buf.Bytes()
+}
+
+// randomBytes returns size pseudo-random bytes derived from seed. Such data barely shrinks under gzip, so it stays
+// large after compression.
+func randomBytes(seed int64, size int) []byte {
+	buf := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(buf)
+	return buf
+}
+
+// TestCreateForShootReplacesStuckTerminatingSecret simulates the real-world failure mode from the request this
+// package addresses: a secret backing a ManagedResource is stuck terminating behind a blocking finalizer. Create
+// must take the new-secret-plus-updated-SecretRef path instead of racing the finalizer, and - on the next
+// reconcile - must keep using the freshly named secret instead of falling back to the (now vacated) canonical
+// name and orphaning it.
+func TestCreateForShootReplacesStuckTerminatingSecret(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	const namespace, name = "shoot--foo--bar", "calico"
+	canonicalSecretName := managedresources.SecretName(name, true)
+	deletionTimestamp := metav1.Now()
+
+	terminating := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              canonicalSecretName,
+			Namespace:         namespace,
+			Finalizers:        []string{"example.com/blocking-finalizer"},
+			DeletionTimestamp: &deletionTimestamp,
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(terminating).Build()
+
+	g.Expect(managedresources.CreateForShoot(ctx, c, namespace, name, false, map[string][]byte{"foo": []byte("bar")})).To(Succeed())
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	g.Expect(mr.Spec.SecretRefs).To(HaveLen(1))
+
+	freshSecretName := mr.Spec.SecretRefs[0].Name
+	g.Expect(freshSecretName).NotTo(Equal(canonicalSecretName), "Create must not hang on the terminating secret")
+
+	// CreateForShoot has already stripped the old secret's finalizers; simulate the garbage collector then reaping
+	// the terminating object, and reconcile again.
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: canonicalSecretName}, terminating)).To(Succeed())
+	g.Expect(terminating.Finalizers).To(BeEmpty())
+	g.Expect(c.Delete(ctx, terminating)).To(Succeed())
+
+	g.Expect(managedresources.CreateForShoot(ctx, c, namespace, name, false, map[string][]byte{"foo": []byte("baz")})).To(Succeed())
+
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	g.Expect(mr.Spec.SecretRefs).To(HaveLen(1))
+	g.Expect(mr.Spec.SecretRefs[0].Name).To(Equal(freshSecretName), "the second reconcile must keep using the renamed secret instead of recreating the canonical one")
+
+	secrets := &corev1.SecretList{}
+	g.Expect(c.List(ctx, secrets, ctrlclient.InNamespace(namespace))).To(Succeed())
+	g.Expect(secrets.Items).To(HaveLen(1), "the renamed secret must not be abandoned in favor of a second, brand new secret")
+}
+
+// TestChunkedCreateShardsCompressedManifestsAndBecomesHealthy exercises the end-to-end path of a rendering that is
+// still too large for a single secret after compression: ChunkedCreate compresses it and shards it across multiple
+// secrets, and once gardener-resource-manager reports the usual conditions, WaitUntilHealthy succeeds.
+func TestChunkedCreateShardsCompressedManifestsAndBecomesHealthy(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	const namespace, name = "shoot--foo--bar", "calico"
+	// Two incompressible 500 KiB values: above the compression threshold, and together still above the shard size
+	// after gzip. Values are never split, so each needs its own key to be able to land in a separate shard.
+	data := map[string][]byte{
+		"calico-a.yaml": randomBytes(1, 500*1024),
+		"calico-b.yaml": randomBytes(2, 500*1024),
+	}
+
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+
+	g.Expect(managedresources.ChunkedCreate(ctx, c, namespace, name, true, "", data, pointer.BoolPtr(false), nil, pointer.BoolPtr(false))).To(Succeed())
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	g.Expect(len(mr.Spec.SecretRefs)).To(BeNumerically(">", 1), "data that stays too large after compression must be sharded across more than one secret")
+
+	for _, ref := range mr.Spec.SecretRefs {
+		secret := &corev1.Secret{}
+		g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: ref.Name}, secret)).To(Succeed())
+		for key := range secret.Data {
+			g.Expect(strings.HasSuffix(key, ".gz")).To(BeTrue(), "data above the compression threshold must be gzip compressed")
+		}
+	}
+
+	mr.Status.ObservedGeneration = mr.Generation
+	mr.Status.Conditions = []gardencorev1beta1.Condition{
+		{Type: resourcesv1alpha1.ResourcesApplied, Status: gardencorev1beta1.ConditionTrue},
+		{Type: resourcesv1alpha1.ResourcesHealthy, Status: gardencorev1beta1.ConditionTrue},
+	}
+	g.Expect(c.Status().Update(ctx, mr)).To(Succeed())
+
+	g.Expect(managedresources.WaitUntilHealthy(ctx, c, namespace, name)).To(Succeed())
+}
+
+// TestChunkedCreateDeletesShardsDroppedByAShrinkingReconcile guards against the shard-count equivalent of the
+// terminating-secret leak: if a later reconcile renders less data and needs fewer shards than the managed
+// resource currently references, the excess shard secrets must be deleted, not silently dropped from
+// Spec.SecretRefs and orphaned forever.
+func TestChunkedCreateDeletesShardsDroppedByAShrinkingReconcile(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	const namespace, name = "shoot--foo--bar", "calico"
+
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+
+	data := map[string][]byte{
+		"calico-a.yaml": randomBytes(1, 500*1024),
+		"calico-b.yaml": randomBytes(2, 500*1024),
+	}
+	g.Expect(managedresources.ChunkedCreate(ctx, c, namespace, name, true, "", data, pointer.BoolPtr(false), nil, pointer.BoolPtr(false))).To(Succeed())
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	shardCountBefore := len(mr.Spec.SecretRefs)
+	g.Expect(shardCountBefore).To(BeNumerically(">", 1), "the test manifest must actually need more than one shard to exercise the bug")
+
+	g.Expect(managedresources.ChunkedCreate(ctx, c, namespace, name, true, "", map[string][]byte{"calico.yaml": []byte("tiny")}, pointer.BoolPtr(false), nil, pointer.BoolPtr(false))).To(Succeed())
+
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	g.Expect(mr.Spec.SecretRefs).To(HaveLen(1), "a much smaller payload must need only a single shard")
+
+	secrets := &corev1.SecretList{}
+	g.Expect(c.List(ctx, secrets, ctrlclient.InNamespace(namespace))).To(Succeed())
+	g.Expect(secrets.Items).To(HaveLen(1), "shards the managed resource no longer references must be deleted, not left behind as orphans")
+}
+
+// TestDiffReadsAllShardsOfAChunkedCreatedManagedResource guards against Diff only ever looking at the secret under
+// the canonical SecretName: re-diffing the exact manifests ChunkedCreate just wrote - spread across more than one
+// shard secret - must report no changes, not "every object beyond the first shard was added".
+func TestDiffReadsAllShardsOfAChunkedCreatedManagedResource(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	const namespace, name = "shoot--foo--bar", "calico"
+	// Compression is disabled so the two ~400 KiB values keep their size and together exceed a single shard; the
+	// second value's objects are renamed so that a Diff reading only the first shard would report them as added.
+	data := map[string][]byte{
+		"calico-a.yaml": calicoLikeManifest(1500),
+		"calico-b.yaml": bytes.ReplaceAll(calicoLikeManifest(1500), []byte("calico-config-"), []byte("calico-node-config-")),
+	}
+
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+
+	g.Expect(managedresources.ChunkedCreate(ctx, c, namespace, name, true, "", data, pointer.BoolPtr(false), nil, pointer.BoolPtr(false), managedresources.WithCompressionThreshold(0))).To(Succeed())
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	g.Expect(len(mr.Spec.SecretRefs)).To(BeNumerically(">", 1), "the test manifest must actually need more than one shard to exercise the bug")
+
+	diff, err := managedresources.Diff(ctx, c, namespace, name, true, data)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(diff.Empty()).To(BeTrue(), "re-diffing the manifests ChunkedCreate just wrote must report no changes across all shards, not just the first")
+}
+
+// TestWaitUntilAppliedSucceedsOnceResourcesAppliedIsTrue exercises the success path of WaitUntilApplied (and, by
+// extension, waitUntilCondition/getCondition): once gardener-resource-manager reports ResourcesApplied=True, the
+// wait must return without error, without requiring a second poll.
+func TestWaitUntilAppliedSucceedsOnceResourcesAppliedIsTrue(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	const namespace, name = "shoot--foo--bar", "calico"
+
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	g.Expect(managedresources.CreateForShoot(ctx, c, namespace, name, false, map[string][]byte{"foo": []byte("bar")})).To(Succeed())
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	g.Expect(c.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	mr.Status.Conditions = []gardencorev1beta1.Condition{
+		{Type: resourcesv1alpha1.ResourcesApplied, Status: gardencorev1beta1.ConditionTrue},
+	}
+	g.Expect(c.Status().Update(ctx, mr)).To(Succeed())
+
+	g.Expect(managedresources.WaitUntilApplied(ctx, c, namespace, name)).To(Succeed())
+}
+
+// TestWaitUntilAppliedReturnsConditionErrorOnFailure guards against waitUntilCondition swallowing a reported
+// failure: once gardener-resource-manager reports ResourcesApplied=False, WaitUntilApplied must give up with a
+// *ConditionError carrying the condition's Reason/Message, not a bare timeout, so callers can surface why the
+// apply failed without having to `kubectl describe` the managed resource.
+func TestWaitUntilAppliedReturnsConditionErrorOnFailure(t *testing.T) {
+	g := NewWithT(t)
+	bgCtx := context.Background()
+
+	const namespace, name = "shoot--foo--bar", "calico"
+
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).Build()
+	g.Expect(managedresources.CreateForShoot(bgCtx, c, namespace, name, false, map[string][]byte{"foo": []byte("bar")})).To(Succeed())
+
+	mr := &resourcesv1alpha1.ManagedResource{}
+	g.Expect(c.Get(bgCtx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, mr)).To(Succeed())
+	mr.Status.Conditions = []gardencorev1beta1.Condition{
+		{Type: resourcesv1alpha1.ResourcesApplied, Status: gardencorev1beta1.ConditionFalse, Reason: "ApplyFailed", Message: "could not apply DaemonSet calico-node"},
+	}
+	g.Expect(c.Status().Update(bgCtx, mr)).To(Succeed())
+
+	ctx, cancel := context.WithTimeout(bgCtx, 50*time.Millisecond)
+	defer cancel()
+
+	err := managedresources.WaitUntilApplied(ctx, c, namespace, name, managedresources.WithWaitInterval(10*time.Millisecond))
+	g.Expect(err).To(HaveOccurred())
+
+	var conditionErr *managedresources.ConditionError
+	g.Expect(errors.As(err, &conditionErr)).To(BeTrue(), "the returned error must be (or wrap) a *ConditionError")
+	g.Expect(conditionErr.Reason).To(Equal("ApplyFailed"))
+	g.Expect(conditionErr.Message).To(Equal("could not apply DaemonSet calico-node"))
+}
+
+// TestCreateFromUnstructuredOrderedWaitsForCRDsOnTargetClient guards against waitUntilCRDsEstablished polling the
+// wrong cluster: for a shoot-class managed resource the CRDs it bundles are applied by the shoot's
+// gardener-resource-manager into the shoot itself, not the seed, so CreateFromUnstructuredOrdered must poll
+// targetClient rather than c (the seed client used to write the Secret/ManagedResource).
+func TestCreateFromUnstructuredOrderedWaitsForCRDsOnTargetClient(t *testing.T) {
+	g := NewWithT(t)
+
+	const namespace, name = "shoot--foo--bar", "calico-crds"
+	crdGVK := schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+	crdListGVK := schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinitionList"}
+
+	s := newTestScheme(t)
+	s.AddKnownTypeWithName(crdGVK, &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(crdListGVK, &unstructured.UnstructuredList{})
+
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(crdGVK)
+	crd.SetName("felixconfigurations.crd.projectcalico.org")
+
+	established := crd.DeepCopy()
+	g.Expect(unstructured.SetNestedSlice(established.Object, []interface{}{
+		map[string]interface{}{"type": "Established", "status": "True"},
+	}, "status", "conditions")).To(Succeed())
+
+	seedClient := fake.NewClientBuilder().WithScheme(s).Build()
+	shootClient := fake.NewClientBuilder().WithScheme(s).WithObjects(established).Build()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	g.Expect(managedresources.CreateFromUnstructuredOrdered(ctx, seedClient, shootClient, namespace, name, true, "", []*unstructured.Unstructured{crd}, false, nil, true)).To(Succeed(),
+		"the CRD is only Established on the shoot (targetClient); polling the seed client instead would never succeed")
+}
+
+// BenchmarkChunkedCreateGzipCompression reports the secret payload size with and without gzip compression for a
+// typical, large Calico-sized rendering, demonstrating the reduction ChunkedCreate's default compression achieves.
+func BenchmarkChunkedCreateGzipCompression(b *testing.B) {
+	manifest := calicoLikeManifest(4000)
+
+	b.ReportMetric(float64(len(manifest)), "uncompressed-bytes")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ctx := context.Background()
+		c := fake.NewClientBuilder().WithScheme(newTestScheme(b)).Build()
+		name := fmt.Sprintf("calico-%d", i)
+
+		if err := managedresources.ChunkedCreate(ctx, c, "shoot--foo--bar", name, true, "", map[string][]byte{"calico.yaml": manifest}, pointer.BoolPtr(false), nil, pointer.BoolPtr(false)); err != nil {
+			b.Fatal(err)
+		}
+
+		if i == 0 {
+			secrets := &corev1.SecretList{}
+			if err := c.List(ctx, secrets, ctrlclient.InNamespace("shoot--foo--bar")); err != nil {
+				b.Fatal(err)
+			}
+
+			var compressedBytes int
+			for _, secret := range secrets.Items {
+				for _, v := range secret.Data {
+					compressedBytes += len(v)
+				}
+			}
+			b.ReportMetric(float64(compressedBytes), "compressed-bytes")
+		}
+	}
+}